@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Codec abstracts the serialization format used to persist a record to
+// disk. Implementations decide both how bytes are produced/consumed and
+// which file extension identifies them, so the driver never hard-codes
+// a format.
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+	Extension() string
+}
+
+// JSONCodec is the default codec and preserves the driver's original
+// on-disk format (indented JSON, ".json" files).
+type JSONCodec struct{}
+
+func (JSONCodec) Marshal(v interface{}) ([]byte, error) {
+	b, err := json.MarshalIndent(v, "", "\t")
+	if err != nil {
+		return nil, err
+	}
+	return append(b, byte('\n')), nil
+}
+
+func (JSONCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+func (JSONCodec) Extension() string {
+	return "json"
+}
+
+// BSONCodec stores records as BSON documents, which avoids JSON's
+// lossy handling of numeric types (callers no longer need json.Number)
+// and is more compact for larger records.
+type BSONCodec struct{}
+
+func (BSONCodec) Marshal(v interface{}) ([]byte, error) {
+	return bson.Marshal(v)
+}
+
+func (BSONCodec) Unmarshal(data []byte, v interface{}) error {
+	return bson.Unmarshal(data, v)
+}
+
+func (BSONCodec) Extension() string {
+	return "bson"
+}
@@ -0,0 +1,35 @@
+package main
+
+import "testing"
+
+// TestBSONCodecRoundTrip writes and reads a record through a driver
+// configured with BSONCodec, proving Write/Read round-trip the same way
+// they do under the default JSONCodec.
+func TestBSONCodecRoundTrip(t *testing.T) {
+	db, err := New(t.TempDir(), &Options{Codec: BSONCodec{}})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	type address struct {
+		City string
+	}
+	type user struct {
+		Name    string
+		Age     int
+		Address address
+	}
+
+	want := user{Name: "ramesh", Age: 23, Address: address{City: "jaipur"}}
+	if err := db.Write("users", want.Name, want); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	var got user
+	if err := db.Read("users", want.Name, &got); err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if got != want {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,12 @@
+package main
+
+import "errors"
+
+// Sentinel errors returned by Driver methods so callers can use
+// errors.Is instead of matching on error strings.
+var (
+	ErrMissingCollection  = errors.New("missing collection")
+	ErrMissingResource    = errors.New("missing resource")
+	ErrNotFound           = errors.New("resource not found")
+	ErrCollectionNotFound = errors.New("collection not found")
+)
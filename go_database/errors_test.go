@@ -0,0 +1,43 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestReadMissingResourceIsErrNotFound(t *testing.T) {
+	db, err := New(t.TempDir(), nil)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	var out map[string]interface{}
+	err = db.Read("users", "ghost", &out)
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Read of missing resource: got %v, want errors.Is(err, ErrNotFound)", err)
+	}
+}
+
+func TestDeleteMissingResourceIsErrNotFound(t *testing.T) {
+	db, err := New(t.TempDir(), nil)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	err = db.Delete("users", "ghost")
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Delete of missing resource: got %v, want errors.Is(err, ErrNotFound)", err)
+	}
+}
+
+func TestWriteMissingCollectionIsErrMissingCollection(t *testing.T) {
+	db, err := New(t.TempDir(), nil)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	err = db.Write("", "ghost", map[string]string{"v": "1"})
+	if !errors.Is(err, ErrMissingCollection) {
+		t.Fatalf("Write with no collection: got %v, want errors.Is(err, ErrMissingCollection)", err)
+	}
+}
@@ -0,0 +1,363 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+)
+
+const indexesDir = ".indexes"
+
+// index maps every distinct value seen at Field to the resource IDs of
+// the records holding it. It is persisted as its own JSON file so it
+// survives restarts and can be checked for staleness against the
+// collection's record files.
+type index struct {
+	Field  string              `json:"field"`
+	Values map[string][]string `json:"values"`
+}
+
+func (d *Driver) indexPath(collection, fieldPath string) string {
+	return filepath.Join(d.dir, collection, indexesDir, fieldPath+".idx")
+}
+
+// CreateIndex builds a secondary index over fieldPath (dot-separated,
+// e.g. "Address.City") for every record currently in collection, and
+// persists it so Query can consult it instead of scanning the whole
+// collection.
+func (d *Driver) CreateIndex(collection, fieldPath string) error {
+	if collection == "" {
+		return fmt.Errorf("%w: no collection to index", ErrMissingCollection)
+	}
+	if fieldPath == "" {
+		return fmt.Errorf("godb: missing field path to index")
+	}
+
+	mutex := d.getOrcreateMutex(collection)
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	idx := index{Field: fieldPath, Values: make(map[string][]string)}
+
+	err := d.iterateLocked(collection, func(name string, raw []byte) error {
+		var generic map[string]interface{}
+		if err := d.codec.Unmarshal(raw, &generic); err != nil {
+			return err
+		}
+
+		value, ok := lookupFieldPath(generic, fieldPath)
+		if !ok {
+			return nil
+		}
+
+		key := fmt.Sprintf("%v", value)
+		idx.Values[key] = append(idx.Values[key], name)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return d.saveIndex(collection, idx)
+}
+
+// Query consults the index built by CreateIndex for field to find the
+// resources whose field equals value, then decodes only those matches
+// into the slice pointed to by out, instead of scanning every record in
+// the collection. A resource an index still references but that has
+// since been deleted is skipped rather than failing the whole query.
+func (d *Driver) Query(collection, field string, value interface{}, out interface{}) error {
+	slicePtr := reflect.ValueOf(out)
+	if slicePtr.Kind() != reflect.Ptr || slicePtr.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("godb: Query requires a pointer to a slice, got %T", out)
+	}
+	sliceVal := slicePtr.Elem()
+	elemType := sliceVal.Type().Elem()
+
+	mutex := d.getOrcreateMutex(collection)
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	idx, err := d.loadIndex(collection, field)
+	if err != nil {
+		return err
+	}
+
+	key, err := d.normalizeIndexValue(value)
+	if err != nil {
+		return err
+	}
+
+	for _, resource := range idx.Values[key] {
+		elemPtr := reflect.New(elemType)
+		if err := d.readLocked(collection, resource, elemPtr.Interface()); err != nil {
+			if errors.Is(err, ErrNotFound) {
+				continue
+			}
+			return err
+		}
+		sliceVal.Set(reflect.Append(sliceVal, elemPtr.Elem()))
+	}
+
+	return nil
+}
+
+// indexValueWrapper round-trips a caller-supplied Query value through the
+// driver's codec so it normalizes the same way a field value does when
+// CreateIndex decodes a record generically (e.g. every JSON number
+// becomes a float64); without this, Query(collection, field, int64(...))
+// could build a key that never matches the one CreateIndex stored.
+type indexValueWrapper struct {
+	V interface{} `json:"v" bson:"v"`
+}
+
+func (d *Driver) normalizeIndexValue(value interface{}) (string, error) {
+	b, err := d.codec.Marshal(indexValueWrapper{V: value})
+	if err != nil {
+		return "", err
+	}
+
+	var wrapped indexValueWrapper
+	if err := d.codec.Unmarshal(b, &wrapped); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%v", wrapped.V), nil
+}
+
+func (d *Driver) saveIndex(collection string, idx index) error {
+	dir := filepath.Join(d.dir, collection, indexesDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	b, err := json.MarshalIndent(idx, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	finalPath := d.indexPath(collection, idx.Field)
+	tempPath := finalPath + ".tmp"
+
+	if err := ioutil.WriteFile(tempPath, b, 0644); err != nil {
+		return err
+	}
+
+	return atomicRename(tempPath, finalPath)
+}
+
+func (d *Driver) loadIndex(collection, fieldPath string) (index, error) {
+	b, err := ioutil.ReadFile(d.indexPath(collection, fieldPath))
+	if os.IsNotExist(err) {
+		return index{}, fmt.Errorf("godb: no index on %s.%s, call CreateIndex first", collection, fieldPath)
+	}
+	if err != nil {
+		return index{}, err
+	}
+
+	var idx index
+	if err := json.Unmarshal(b, &idx); err != nil {
+		return index{}, err
+	}
+	return idx, nil
+}
+
+// updateIndexesOnWrite keeps every existing index for collection in sync
+// with a record that was just written: the resource is dropped from
+// every value bucket it previously belonged to, then reinserted under
+// its current value. b is the record's already-encoded bytes, so both a
+// single Write and a WriteBatch/WAL replay can reuse this without
+// re-marshaling.
+func (d *Driver) updateIndexesOnWrite(collection, resource string, b []byte) error {
+	fields, err := d.indexedFields(collection)
+	if err != nil || len(fields) == 0 {
+		return err
+	}
+
+	var generic map[string]interface{}
+	if err := d.codec.Unmarshal(b, &generic); err != nil {
+		return err
+	}
+
+	for _, field := range fields {
+		idx, err := d.loadIndex(collection, field)
+		if err != nil {
+			return err
+		}
+
+		removeFromIndex(&idx, resource)
+
+		if value, ok := lookupFieldPath(generic, field); ok {
+			key := fmt.Sprintf("%v", value)
+			idx.Values[key] = append(idx.Values[key], resource)
+		}
+
+		if err := d.saveIndex(collection, idx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// updateIndexesOnDelete removes resource from every existing index for
+// collection.
+func (d *Driver) updateIndexesOnDelete(collection, resource string) error {
+	fields, err := d.indexedFields(collection)
+	if err != nil || len(fields) == 0 {
+		return err
+	}
+
+	for _, field := range fields {
+		idx, err := d.loadIndex(collection, field)
+		if err != nil {
+			return err
+		}
+		removeFromIndex(&idx, resource)
+		if err := d.saveIndex(collection, idx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// indexedFields lists the fields collection currently has indexes for.
+func (d *Driver) indexedFields(collection string) ([]string, error) {
+	dir := filepath.Join(d.dir, collection, indexesDir)
+
+	entries, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	fields := make([]string, 0, len(entries))
+	for _, fi := range entries {
+		if strings.HasSuffix(fi.Name(), ".idx") {
+			fields = append(fields, strings.TrimSuffix(fi.Name(), ".idx"))
+		}
+	}
+	return fields, nil
+}
+
+// rebuildStaleIndexes is run once from New: if any collection's record
+// files were modified more recently than one of its index files (e.g.
+// because a crash skipped the incremental update), the index is rebuilt
+// from scratch rather than trusted as-is.
+func (d *Driver) rebuildStaleIndexes() error {
+	collections, err := ioutil.ReadDir(d.dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, c := range collections {
+		if !c.IsDir() || c.Name() == walDir {
+			continue
+		}
+		collection := c.Name()
+
+		fields, err := d.indexedFields(collection)
+		if err != nil {
+			return err
+		}
+
+		for _, field := range fields {
+			stale, err := d.indexIsStale(collection, field)
+			if err != nil {
+				return err
+			}
+			if stale {
+				d.log.Info("Rebuilding stale index on %s.%s\n", collection, field)
+				if err := d.CreateIndex(collection, field); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (d *Driver) indexIsStale(collection, field string) (bool, error) {
+	idxInfo, err := os.Stat(d.indexPath(collection, field))
+	if err != nil {
+		return false, err
+	}
+
+	dir := filepath.Join(d.dir, collection)
+	records, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return false, err
+	}
+
+	for _, r := range records {
+		if r.IsDir() {
+			continue
+		}
+		if r.ModTime().After(idxInfo.ModTime()) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func removeFromIndex(idx *index, resource string) {
+	for key, ids := range idx.Values {
+		kept := ids[:0]
+		for _, id := range ids {
+			if id != resource {
+				kept = append(kept, id)
+			}
+		}
+		if len(kept) == 0 {
+			delete(idx.Values, key)
+		} else {
+			idx.Values[key] = kept
+		}
+	}
+}
+
+// lookupFieldPath resolves a dot-separated path such as "Address.City"
+// against a generically decoded record. Path segments are matched
+// case-insensitively against the decoded map's keys: callers write
+// fieldPath against their Go struct's field names, but a codec like
+// BSONCodec lowercases untagged field names on Marshal, so a literal
+// match would silently miss every field under that codec.
+func lookupFieldPath(generic map[string]interface{}, fieldPath string) (interface{}, bool) {
+	parts := strings.Split(fieldPath, ".")
+
+	var current interface{} = generic
+	for _, part := range parts {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		current, ok = lookupKeyFold(m, part)
+		if !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// lookupKeyFold looks up key in m, falling back to a case-insensitive
+// match if the exact key isn't present.
+func lookupKeyFold(m map[string]interface{}, key string) (interface{}, bool) {
+	if v, ok := m[key]; ok {
+		return v, true
+	}
+	for k, v := range m {
+		if strings.EqualFold(k, key) {
+			return v, true
+		}
+	}
+	return nil, false
+}
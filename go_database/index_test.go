@@ -0,0 +1,104 @@
+package main
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestQueryWithBSONCodec pins the case-fold fix in lookupFieldPath: BSON
+// lowercases untagged struct field names on Marshal, so CreateIndex's
+// generically-decoded record has an "address"/"city" key even though
+// fieldPath is written against the Go struct's capitalized field names.
+func TestQueryWithBSONCodec(t *testing.T) {
+	db, err := New(t.TempDir(), &Options{Codec: BSONCodec{}})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	type address struct {
+		City string
+	}
+	type user struct {
+		Name    string
+		Address address
+	}
+
+	users := []user{
+		{Name: "ramesh", Address: address{City: "jaipur"}},
+		{Name: "mukesh", Address: address{City: "udaipur"}},
+	}
+	for _, u := range users {
+		if err := db.Write("users", u.Name, u); err != nil {
+			t.Fatalf("Write(%q): %v", u.Name, err)
+		}
+	}
+
+	if err := db.CreateIndex("users", "Address.City"); err != nil {
+		t.Fatalf("CreateIndex: %v", err)
+	}
+
+	var out []user
+	if err := db.Query("users", "Address.City", "jaipur", &out); err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	if len(out) != 1 || out[0].Name != "ramesh" {
+		t.Fatalf("got %+v, want exactly the jaipur user", out)
+	}
+}
+
+// TestQueryDuringConcurrentWrite pins the recursive-RLock deadlock fix:
+// Query used to call the self-locking Read while already holding the
+// collection's RLock, which deadlocks the instant a writer is pending.
+func TestQueryDuringConcurrentWrite(t *testing.T) {
+	db, err := New(t.TempDir(), nil)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	for i := 0; i < 20; i++ {
+		name := "user" + strconv.Itoa(i)
+		if err := db.Write("users", name, map[string]string{"City": "jaipur"}); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+	if err := db.CreateIndex("users", "City"); err != nil {
+		t.Fatalf("CreateIndex: %v", err)
+	}
+
+	var writerWG sync.WaitGroup
+	writerWG.Add(1)
+	go func() {
+		defer writerWG.Done()
+		for i := 0; i < 100; i++ {
+			db.Write("users", "user0", map[string]string{"City": "jaipur"})
+		}
+	}()
+
+	var readerWG sync.WaitGroup
+	readerWG.Add(1)
+	go func() {
+		defer readerWG.Done()
+		for i := 0; i < 100; i++ {
+			var out []map[string]string
+			if err := db.Query("users", "City", "jaipur", &out); err != nil {
+				t.Errorf("Query: %v", err)
+				return
+			}
+		}
+	}()
+
+	done := make(chan struct{})
+	go func() {
+		writerWG.Wait()
+		readerWG.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Query deadlocked against a concurrent Write")
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+)
+
+// ErrStopIteration can be returned by an Iterate callback to abort the
+// scan early without that being treated as a failure.
+var ErrStopIteration = errors.New("stop iteration")
+
+// Iterate walks collection one record at a time, handing each file's raw
+// bytes to fn, instead of loading the whole collection into memory the
+// way ReadAll does. fn may return ErrStopIteration to abort the scan
+// early; any other error aborts the scan and is returned to the caller.
+func (d *Driver) Iterate(collection string, fn func(name string, raw []byte) error) error {
+	if collection == "" {
+		return fmt.Errorf("%w: unable to read", ErrMissingCollection)
+	}
+
+	mutex := d.getOrcreateMutex(collection)
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	return d.iterateLocked(collection, fn)
+}
+
+// iterateLocked is Iterate's body without taking the collection mutex,
+// for callers (like CreateIndex) that need to scan the collection while
+// already holding it.
+func (d *Driver) iterateLocked(collection string, fn func(name string, raw []byte) error) error {
+	dir := filepath.Join(d.dir, collection)
+
+	if _, err := d.stat(dir); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return fmt.Errorf("%w: %s", ErrCollectionNotFound, collection)
+		}
+		return err
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	ext := "." + d.codec.Extension()
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), ext) {
+			continue
+		}
+
+		b, err := ioutil.ReadFile(filepath.Join(dir, file.Name()))
+		if err != nil {
+			return err
+		}
+
+		name := strings.TrimSuffix(file.Name(), ext)
+		if err := fn(name, b); err != nil {
+			if errors.Is(err, ErrStopIteration) {
+				return nil
+			}
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Decode iterates collection and, for every record where filter returns
+// true (or filter is nil), unmarshals it and appends it to the slice
+// pointed to by into. It exists alongside Iterate for callers who want
+// filtered results without hand-rolling the reflection needed to grow a
+// caller-provided slice.
+func (d *Driver) Decode(collection string, into interface{}, filter func(raw []byte) bool) error {
+	slicePtr := reflect.ValueOf(into)
+	if slicePtr.Kind() != reflect.Ptr || slicePtr.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("godb: Decode requires a pointer to a slice, got %T", into)
+	}
+
+	sliceVal := slicePtr.Elem()
+	elemType := sliceVal.Type().Elem()
+
+	return d.Iterate(collection, func(name string, raw []byte) error {
+		if filter != nil && !filter(raw) {
+			return nil
+		}
+
+		elemPtr := reflect.New(elemType)
+		if err := d.codec.Unmarshal(raw, elemPtr.Interface()); err != nil {
+			return err
+		}
+
+		sliceVal.Set(reflect.Append(sliceVal, elemPtr.Elem()))
+		return nil
+	})
+}
@@ -2,10 +2,12 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 
 	"github.com/jcelliott/lumber"
@@ -25,14 +27,17 @@ type (
 
 	Driver struct {
 		mutex   sync.Mutex
-		mutexes map[string]*sync.Mutex
+		mutexes map[string]*sync.RWMutex
 		dir     string
 		log     Logger
+		codec   Codec
+		walSeq  uint64
 	}
 )
 
 type Options struct {
 	Logger
+	Codec Codec
 }
 
 func New(dir string, options *Options) (*Driver, error) {
@@ -48,90 +53,133 @@ func New(dir string, options *Options) (*Driver, error) {
 		opts.Logger = lumber.NewConsoleLogger(lumber.INFO)
 	}
 
+	if opts.Codec == nil {
+		opts.Codec = JSONCodec{}
+	}
+
 	driver := Driver{
 		dir:     dir,
-		mutexes: make(map[string]*sync.Mutex),
+		mutexes: make(map[string]*sync.RWMutex),
 		log:     opts.Logger,
+		codec:   opts.Codec,
 	}
 
 	if _, err := os.Stat(dir); err == nil {
 		opts.Logger.Debug("Using '%s' (database already exists)\n", dir)
-		return &driver, nil
+		if err := driver.replayWAL(); err != nil {
+			return &driver, err
+		}
+		return &driver, driver.rebuildStaleIndexes()
 	}
 	opts.Logger.Debug("Creating the database at '%s'...\n", dir)
-	return &driver, os.MkdirAll(dir, 0755)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return &driver, err
+	}
+	return &driver, driver.replayWAL()
 }
 
 func (d *Driver) Write(collection, resource string, v interface{}) error {
 	if collection == "" {
-		return fmt.Errorf("Missing the collection - no place to save record!")
+		return fmt.Errorf("%w: no place to save record", ErrMissingCollection)
 	}
 	if resource == "" {
-		return fmt.Errorf("Missing resource - unable to save the record (no name)!")
+		return fmt.Errorf("%w: unable to save the record (no name)", ErrMissingResource)
 	}
 	mutex := d.getOrcreateMutex(collection)
 	mutex.Lock()
 	defer mutex.Unlock()
 
-	dir := filepath.Join(d.dir, collection)
-	finalPath := filepath.Join(dir, resource+".json")
-	tempPath := finalPath + ".tmp"
-
-	if err := os.MkdirAll(dir, 0755); err != nil {
+	b, err := d.codec.Marshal(v)
+	if err != nil {
 		return err
 	}
 
-	b, err := json.MarshalIndent(v, "", "\t")
-	if err != nil {
+	if err := d.writeRecordFile(collection, resource, b); err != nil {
 		return err
 	}
 
-	b = append(b, byte('\n'))
+	return d.updateIndexesOnWrite(collection, resource, b)
+}
+
+// writeRecordFile performs the tmp-file + atomic rename dance for a single
+// already-encoded record. Callers are responsible for holding the
+// collection's mutex.
+func (d *Driver) writeRecordFile(collection, resource string, b []byte) error {
+	dir := filepath.Join(d.dir, collection)
+	finalPath := filepath.Join(dir, resource+"."+d.codec.Extension())
+	tempPath := finalPath + ".tmp"
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
 
 	if err := ioutil.WriteFile(tempPath, b, 0644); err != nil {
 		return err
 	}
 
-	return os.Rename(tempPath, finalPath)
+	return atomicRename(tempPath, finalPath)
 }
 
 func (d *Driver) Read(collection, resource string, v interface{}) error {
 	if collection == "" {
-		return fmt.Errorf("Missing collection - unable to read")
+		return fmt.Errorf("%w: unable to read", ErrMissingCollection)
 	}
 
 	if resource == "" {
-		return fmt.Errorf("Missing resource - unable to read record (no name)!")
+		return fmt.Errorf("%w: unable to read record (no name)", ErrMissingResource)
 	}
 
+	mutex := d.getOrcreateMutex(collection)
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	return d.readLocked(collection, resource, v)
+}
+
+// readLocked is Read's body without taking the collection mutex, for
+// callers (like Query) that need to read a record while already holding
+// it; recursing into Read would try to RLock an RWMutex the goroutine
+// already holds, which deadlocks the instant a writer is pending.
+func (d *Driver) readLocked(collection, resource string, v interface{}) error {
 	record := filepath.Join(d.dir, collection, resource)
 
-	if _, err := stat(record); err != nil {
+	if _, err := d.stat(record); err != nil {
 		return err
 	}
 
-	b, err := ioutil.ReadFile(record + ".json")
+	b, err := ioutil.ReadFile(record + "." + d.codec.Extension())
 	if err != nil {
 		return err
 	}
 
-	return json.Unmarshal(b, v)
+	return d.codec.Unmarshal(b, v)
 }
 
 func (d *Driver) ReadAll(collection string) ([]string, error) {
 	if collection == "" {
-		return nil, fmt.Errorf("Missing collection - unable to read")
+		return nil, fmt.Errorf("%w: unable to read", ErrMissingCollection)
 	}
+	mutex := d.getOrcreateMutex(collection)
+	mutex.RLock()
+	defer mutex.RUnlock()
+
 	dir := filepath.Join(d.dir, collection)
 
-	if _, err := stat(dir); err != nil {
+	if _, err := d.stat(dir); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil, fmt.Errorf("%w: %s", ErrCollectionNotFound, collection)
+		}
 		return nil, err
 	}
 
 	files, _ := ioutil.ReadDir(dir)
 
+	ext := "." + d.codec.Extension()
 	var records []string
 	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), ext) {
+			continue
+		}
 		b, err := ioutil.ReadFile(filepath.Join(dir, file.Name()))
 		if err != nil {
 			return nil, err
@@ -149,33 +197,39 @@ func (d *Driver) Delete(collection, resource string) error {
 
 	dir := filepath.Join(d.dir, path)
 
-	switch fi, err := stat(dir); {
+	switch fi, err := d.stat(dir); {
 	case fi == nil, err != nil:
-		return fmt.Errorf("Unable to find file or directory named %v\n", path)
+		return fmt.Errorf("%w: %v", ErrNotFound, path)
 
 	case fi.Mode().IsDir():
 		return os.RemoveAll(dir)
 
 	case fi.Mode().IsRegular():
-		return os.Remove(dir + ".json")
+		if err := os.Remove(dir + "." + d.codec.Extension()); err != nil {
+			return err
+		}
+		return d.updateIndexesOnDelete(collection, resource)
 	}
 	return nil
 }
 
-func (d *Driver) getOrcreateMutex(collection string) *sync.Mutex {
+func (d *Driver) getOrcreateMutex(collection string) *sync.RWMutex {
 	d.mutex.Lock()
 	defer d.mutex.Unlock()
 	m, ok := d.mutexes[collection]
 	if !ok {
-		m = &sync.Mutex{}
+		m = &sync.RWMutex{}
 		d.mutexes[collection] = m
 	}
 	return m
 }
 
-func stat(path string) (fi os.FileInfo, err error) {
+func (d *Driver) stat(path string) (fi os.FileInfo, err error) {
 	if fi, err = os.Stat(path); os.IsNotExist(err) {
-		fi, err = os.Stat(path + ".json")
+		fi, err = os.Stat(path + "." + d.codec.Extension())
+	}
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, path)
 	}
 	return fi, err
 }
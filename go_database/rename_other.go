@@ -0,0 +1,12 @@
+//go:build !windows
+
+package main
+
+import "os"
+
+// atomicRename renames tempPath to finalPath. On every platform except
+// Windows, os.Rename already replaces an existing destination
+// atomically, so there's nothing extra to do here.
+func atomicRename(tempPath, finalPath string) error {
+	return os.Rename(tempPath, finalPath)
+}
@@ -0,0 +1,42 @@
+//go:build windows
+
+package main
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+var (
+	modkernel32     = syscall.NewLazyDLL("kernel32.dll")
+	procMoveFileExW = modkernel32.NewProc("MoveFileExW")
+)
+
+const moveFileReplaceExisting = 0x1
+
+// atomicRename renames tempPath to finalPath. os.Rename maps to
+// MoveFileW on Windows, which fails with ERROR_ALREADY_EXISTS if
+// finalPath is already present, so overwriting an existing record would
+// otherwise make Write unreliable. MoveFileEx with
+// MOVEFILE_REPLACE_EXISTING gives the same overwrite-on-rename semantics
+// Write already relies on everywhere else.
+func atomicRename(tempPath, finalPath string) error {
+	from, err := syscall.UTF16PtrFromString(tempPath)
+	if err != nil {
+		return err
+	}
+	to, err := syscall.UTF16PtrFromString(finalPath)
+	if err != nil {
+		return err
+	}
+
+	r1, _, err := procMoveFileExW.Call(
+		uintptr(unsafe.Pointer(from)),
+		uintptr(unsafe.Pointer(to)),
+		uintptr(moveFileReplaceExisting),
+	)
+	if r1 == 0 {
+		return err
+	}
+	return nil
+}